@@ -0,0 +1,132 @@
+package naming
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+const (
+	_cacheSchemaVersion = 1
+	// _cacheMaxBytes bounds the on-disk cache so a runaway watch set can't
+	// turn it into an unbounded write; a flush whose snapshot exceeds it is
+	// skipped, leaving the file as it was.
+	_cacheMaxBytes = 8 << 20 // 8MiB
+
+	_cacheFlushInterval = time.Second
+)
+
+// cacheSnapshot is the on-disk format of Config.CacheFile: the full
+// map[appID]appData known at the last successful broadcast, with a schema
+// version for forward compatibility and a checksum guarding against a
+// truncated or corrupted write.
+type cacheSnapshot struct {
+	Version  int                `json:"version"`
+	Apps     map[string]appData `json:"apps"`
+	Checksum string             `json:"checksum"`
+}
+
+// loadCache seeds b.apps from b.cacheFile, if set and readable, so Fetch
+// can serve the last-known instances before the first poll succeeds. Any
+// problem reading, parsing, or verifying the file is logged and otherwise
+// ignored -- a cold start with no cache is not an error.
+func (b *httpBackend) loadCache() {
+	if b.cacheFile == "" {
+		return
+	}
+	raw, err := ioutil.ReadFile(b.cacheFile)
+	if err != nil {
+		return
+	}
+	var snap cacheSnapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		log.Errorf("discovery: cache file(%s) unmarshal error(%v), ignoring", b.cacheFile, err)
+		return
+	}
+	if snap.Version != _cacheSchemaVersion {
+		log.Warningf("discovery: cache file(%s) schema version(%d) unsupported, ignoring", b.cacheFile, snap.Version)
+		return
+	}
+	body, err := json.Marshal(snap.Apps)
+	if err != nil || checksum(body) != snap.Checksum {
+		log.Errorf("discovery: cache file(%s) checksum mismatch, ignoring", b.cacheFile)
+		return
+	}
+	b.mutex.Lock()
+	for appID, ad := range snap.Apps {
+		app := &appInfo{lastTs: ad.LastTs, stale: 1} // no concurrent access yet, plain init is fine
+		app.zoneIns.Store(ad.ZoneInstances)
+		b.apps[appID] = app
+	}
+	b.mutex.Unlock()
+	log.Infof("discovery: seeded %d app(s) from cache file(%s)", len(snap.Apps), b.cacheFile)
+}
+
+// cacheflush is the discovery.cacheflush goroutine: it writes b.apps to
+// b.cacheFile at most once per _cacheFlushInterval, coalescing any number
+// of broadcast()-triggered flushNotify signals into a single write.
+func (b *httpBackend) cacheflush(ctx context.Context) {
+	defer b.wg.Done()
+	log.Infof("discovery.cacheflush: starting")
+	ticker := time.NewTicker(_cacheFlushInterval)
+	defer ticker.Stop()
+	var dirty bool
+	for {
+		select {
+		case <-ctx.Done():
+			if dirty {
+				b.flushCacheNow()
+			}
+			log.Infof("discovery.cacheflush: stopped")
+			return
+		case <-b.flushNotify:
+			dirty = true
+		case <-ticker.C:
+			if dirty {
+				dirty = false
+				b.flushCacheNow()
+			}
+		}
+	}
+}
+
+// flushCacheNow writes the current b.apps snapshot to b.cacheFile.
+func (b *httpBackend) flushCacheNow() {
+	b.mutex.RLock()
+	apps := make(map[string]appData, len(b.apps))
+	for appID, app := range b.apps {
+		zoneIns, _ := app.zoneIns.Load().(map[string][]*Instance)
+		apps[appID] = appData{ZoneInstances: zoneIns, LastTs: atomic.LoadInt64(&app.lastTs)}
+	}
+	b.mutex.RUnlock()
+
+	body, err := json.Marshal(apps)
+	if err != nil {
+		log.Errorf("discovery: marshal cache error(%v)", err)
+		return
+	}
+	if len(body) > _cacheMaxBytes {
+		log.Warningf("discovery: cache snapshot(%d bytes) exceeds %d bytes, skipping flush", len(body), _cacheMaxBytes)
+		return
+	}
+	raw, err := json.Marshal(cacheSnapshot{Version: _cacheSchemaVersion, Apps: apps, Checksum: checksum(body)})
+	if err != nil {
+		log.Errorf("discovery: marshal cache snapshot error(%v)", err)
+		return
+	}
+	if err := ioutil.WriteFile(b.cacheFile, raw, 0644); err != nil {
+		log.Errorf("discovery: write cache file(%s) error(%v)", b.cacheFile, err)
+	}
+}
+
+func checksum(body []byte) string {
+	h := fnv.New64a()
+	h.Write(body)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
@@ -0,0 +1,56 @@
+package naming
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadCacheMarksStale checks the cold-start path: a backend built
+// against a pre-existing Config.CacheFile seeds its apps from it and
+// reports them via FetchWithMeta as stale, until a live poll overwrites
+// them.
+func TestLoadCacheMarksStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cacheFile := filepath.Join(dir, "discovery.cache")
+
+	apps := map[string]appData{
+		"provider": {
+			ZoneInstances: map[string][]*Instance{
+				"sh1": {{AppID: "provider", Zone: "sh1", Addrs: []string{"127.0.0.1:8080"}}},
+			},
+			LastTs: 1,
+		},
+	}
+	body, err := json.Marshal(apps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(cacheSnapshot{Version: _cacheSchemaVersion, Apps: apps, Checksum: checksum(body)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(cacheFile, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := newHTTPBackend(&Config{Domain: "127.0.0.1:1", CacheFile: cacheFile})
+	defer b.Close()
+
+	ins, stale, ok := b.FetchWithMeta("provider")
+	if !ok {
+		t.Fatal(`FetchWithMeta("provider") ok = false, want true`)
+	}
+	if !stale {
+		t.Error(`FetchWithMeta("provider") stale = false, want true for a cache-seeded app`)
+	}
+	if got := ins["sh1"]; len(got) != 1 || got[0].Addrs[0] != "127.0.0.1:8080" {
+		t.Errorf(`FetchWithMeta("provider") ins = %+v, want the cached instance`, ins)
+	}
+}
@@ -0,0 +1,30 @@
+package naming_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Bilibili/discovery/naming"
+)
+
+// TestDiscoveryCloseWaitsForGoroutines checks that Close() blocks until
+// its background goroutines (discovery.poller and friends) have actually
+// exited, rather than returning while they're still shutting down.
+func TestDiscoveryCloseWaitsForGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	dis := naming.New(&naming.Config{Domain: "127.0.0.1:1", Zone: "sh1", Env: "test"})
+	dis.Watch("provider") // starts the poller goroutine lazily
+
+	// Give the poller goroutine a moment to actually start before Close,
+	// so Close has something real to wait for.
+	time.Sleep(50 * time.Millisecond)
+	if err := dis.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("NumGoroutine() = %d after Close(), want <= %d (goroutines still running)", after, before)
+	}
+}
@@ -0,0 +1,174 @@
+// Hand-written minimal stub for the Discovery service defined in
+// discovery.proto -- NOT protoc-gen-go output. It implements just enough
+// of the generated API (message types, client/server stream wrappers,
+// ServiceDesc) for grpc_backend.go to compile and run against; there is
+// no message Descriptor()/XXX_* machinery or raw file descriptor. If
+// protoc-gen-go is ever run against discovery.proto for real, it will
+// replace this file with a different (larger) API and this hand-rolled
+// version should be discarded.
+
+package discoverypb
+
+import (
+	context "context"
+
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+
+type PollsRequest struct {
+	AppId           []string `protobuf:"bytes,1,rep,name=app_id,json=appId" json:"app_id,omitempty"`
+	LatestTimestamp []int64  `protobuf:"varint,2,rep,packed,name=latest_timestamp,json=latestTimestamp" json:"latest_timestamp,omitempty"`
+	Zone            string   `protobuf:"bytes,3,opt,name=zone" json:"zone,omitempty"`
+	Env             string   `protobuf:"bytes,4,opt,name=env" json:"env,omitempty"`
+	Hostname        string   `protobuf:"bytes,5,opt,name=hostname" json:"hostname,omitempty"`
+}
+
+func (m *PollsRequest) Reset()         { *m = PollsRequest{} }
+func (m *PollsRequest) String() string { return proto.CompactTextString(m) }
+func (*PollsRequest) ProtoMessage()    {}
+
+type Instance struct {
+	AppId           string            `protobuf:"bytes,1,opt,name=app_id,json=appId" json:"app_id,omitempty"`
+	Zone            string            `protobuf:"bytes,2,opt,name=zone" json:"zone,omitempty"`
+	Env             string            `protobuf:"bytes,3,opt,name=env" json:"env,omitempty"`
+	Addrs           []string          `protobuf:"bytes,4,rep,name=addrs" json:"addrs,omitempty"`
+	Color           string            `protobuf:"bytes,5,opt,name=color" json:"color,omitempty"`
+	Version         string            `protobuf:"bytes,6,opt,name=version" json:"version,omitempty"`
+	Metadata        map[string]string `protobuf:"bytes,7,rep,name=metadata" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	LatestTimestamp int64             `protobuf:"varint,8,opt,name=latest_timestamp,json=latestTimestamp" json:"latest_timestamp,omitempty"`
+}
+
+func (m *Instance) Reset()         { *m = Instance{} }
+func (m *Instance) String() string { return proto.CompactTextString(m) }
+func (*Instance) ProtoMessage()    {}
+
+type ZoneInstances struct {
+	Instances []*Instance `protobuf:"bytes,1,rep,name=instances" json:"instances,omitempty"`
+}
+
+func (m *ZoneInstances) Reset()         { *m = ZoneInstances{} }
+func (m *ZoneInstances) String() string { return proto.CompactTextString(m) }
+func (*ZoneInstances) ProtoMessage()    {}
+
+type AppData struct {
+	ZoneInstances   map[string]*ZoneInstances `protobuf:"bytes,1,rep,name=zone_instances,json=zoneInstances" json:"zone_instances,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	LatestTimestamp int64                     `protobuf:"varint,2,opt,name=latest_timestamp,json=latestTimestamp" json:"latest_timestamp,omitempty"`
+}
+
+func (m *AppData) Reset()         { *m = AppData{} }
+func (m *AppData) String() string { return proto.CompactTextString(m) }
+func (*AppData) ProtoMessage()    {}
+
+type PollsResponse struct {
+	AppId string   `protobuf:"bytes,1,opt,name=app_id,json=appId" json:"app_id,omitempty"`
+	Data  *AppData `protobuf:"bytes,2,opt,name=data" json:"data,omitempty"`
+}
+
+func (m *PollsResponse) Reset()         { *m = PollsResponse{} }
+func (m *PollsResponse) String() string { return proto.CompactTextString(m) }
+func (*PollsResponse) ProtoMessage()    {}
+
+func init() {
+	proto.RegisterType((*PollsRequest)(nil), "discoverypb.PollsRequest")
+	proto.RegisterType((*Instance)(nil), "discoverypb.Instance")
+	proto.RegisterType((*ZoneInstances)(nil), "discoverypb.ZoneInstances")
+	proto.RegisterType((*AppData)(nil), "discoverypb.AppData")
+	proto.RegisterType((*PollsResponse)(nil), "discoverypb.PollsResponse")
+}
+
+// DiscoveryClient is the client API for Discovery service.
+type DiscoveryClient interface {
+	Polls(ctx context.Context, in *PollsRequest, opts ...grpc.CallOption) (Discovery_PollsClient, error)
+}
+
+type discoveryClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewDiscoveryClient returns a client for the Discovery gRPC service.
+func NewDiscoveryClient(cc *grpc.ClientConn) DiscoveryClient {
+	return &discoveryClient{cc}
+}
+
+func (c *discoveryClient) Polls(ctx context.Context, in *PollsRequest, opts ...grpc.CallOption) (Discovery_PollsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Discovery_serviceDesc.Streams[0], "/discoverypb.Discovery/Polls", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &discoveryPollsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// Discovery_PollsClient is the client-side stream handle for Polls.
+type Discovery_PollsClient interface {
+	Recv() (*PollsResponse, error)
+	grpc.ClientStream
+}
+
+type discoveryPollsClient struct {
+	grpc.ClientStream
+}
+
+func (x *discoveryPollsClient) Recv() (*PollsResponse, error) {
+	m := new(PollsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DiscoveryServer is the server API for Discovery service.
+type DiscoveryServer interface {
+	Polls(*PollsRequest, Discovery_PollsServer) error
+}
+
+// Discovery_PollsServer is the server-side stream handle for Polls.
+type Discovery_PollsServer interface {
+	Send(*PollsResponse) error
+	grpc.ServerStream
+}
+
+type discoveryPollsServer struct {
+	grpc.ServerStream
+}
+
+func (x *discoveryPollsServer) Send(m *PollsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Discovery_Polls_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PollsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DiscoveryServer).Polls(m, &discoveryPollsServer{stream})
+}
+
+// RegisterDiscoveryServer registers srv to handle the Discovery service on s.
+func RegisterDiscoveryServer(s *grpc.Server, srv DiscoveryServer) {
+	s.RegisterService(&_Discovery_serviceDesc, srv)
+}
+
+var _Discovery_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "discoverypb.Discovery",
+	HandlerType: (*DiscoveryServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Polls",
+			Handler:       _Discovery_Polls_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "discovery.proto",
+}
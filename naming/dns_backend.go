@@ -0,0 +1,141 @@
+package naming
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// DNSConfig configures a DNS SRV backed Backend.
+type DNSConfig struct {
+	// Proto and Domain are passed to net.LookupSRV together with the
+	// appID (used as the SRV service name) on every lookup, e.g.
+	// LookupSRV("provider", "tcp", "default.svc.cluster.local") for a
+	// Kubernetes headless service, or a Consul DNS domain.
+	Proto  string
+	Domain string
+	// Interval between SRV lookups for a watched appID. Defaults to 10s.
+	Interval time.Duration
+}
+
+// dnsBackend is a read-only Backend that resolves instances via DNS SRV
+// records, for interop with Kubernetes headless services / Consul DNS.
+type dnsBackend struct {
+	c DNSConfig
+
+	mutex sync.RWMutex
+	apps  map[string]*appInfo
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewDNSBackend returns a Backend that resolves instances via DNS SRV
+// lookups instead of polling the bilibili discovery cluster. Register is
+// not supported; it always fails with ErrRegisterUnsupported.
+func NewDNSBackend(c DNSConfig) Backend {
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &dnsBackend{
+		c:      c,
+		apps:   map[string]*appInfo{},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Fetch returns the latest discovered instances by appID.
+func (b *dnsBackend) Fetch(appID string) (ins map[string][]*Instance, ok bool) {
+	b.mutex.RLock()
+	app, ok := b.apps[appID]
+	b.mutex.RUnlock()
+	if ok {
+		ins, ok = app.zoneIns.Load().(map[string][]*Instance)
+	}
+	return
+}
+
+// Watch watches appID, resolving it as a DNS SRV service name, and returns
+// a chan to notify on instance change.
+func (b *dnsBackend) Watch(appID string) <-chan struct{} {
+	b.mutex.RLock()
+	app, ok := b.apps[appID]
+	b.mutex.RUnlock()
+	if !ok {
+		app = &appInfo{}
+		b.mutex.Lock()
+		b.apps[appID] = app
+		b.mutex.Unlock()
+		go b.resolveproc(appID, app)
+	}
+	return app.subscribe()
+}
+
+// Unwatch unwatch app changes.
+func (b *dnsBackend) Unwatch(appID string) {
+	b.mutex.Lock()
+	app, ok := b.apps[appID]
+	if ok {
+		delete(b.apps, appID)
+	}
+	b.mutex.Unlock()
+	if ok {
+		app.closeAll()
+	}
+}
+
+// Register is not supported by the DNS SRV backend.
+func (b *dnsBackend) Register(ins *Instance) (cancelFunc context.CancelFunc, err error) {
+	return nil, ErrRegisterUnsupported
+}
+
+// Close stops all outstanding DNS lookups.
+func (b *dnsBackend) Close() error {
+	b.cancel()
+	return nil
+}
+
+func (b *dnsBackend) resolveproc(appID string, app *appInfo) {
+	ticker := time.NewTicker(b.c.Interval)
+	defer ticker.Stop()
+	b.resolve(appID, app)
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+			b.resolve(appID, app)
+		}
+	}
+}
+
+// resolve runs one DNS SRV lookup for appID and stores the result if it
+// differs from what's currently cached.
+func (b *dnsBackend) resolve(appID string, app *appInfo) {
+	_, srvs, err := net.LookupSRV(appID, b.c.Proto, b.c.Domain)
+	if err != nil {
+		log.Errorf("discovery: dns LookupSRV(appid:%s proto:%s domain:%s) error(%v)", appID, b.c.Proto, b.c.Domain, err)
+		return
+	}
+	ins := make([]*Instance, 0, len(srvs))
+	for _, srv := range srvs {
+		ins = append(ins, &Instance{
+			AppID: appID,
+			Addrs: []string{net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))},
+		})
+	}
+	zoneIns := map[string][]*Instance{"": ins}
+	if old, ok := app.zoneIns.Load().(map[string][]*Instance); ok && reflect.DeepEqual(old, zoneIns) {
+		return
+	}
+	app.zoneIns.Store(zoneIns)
+	app.notify()
+}
@@ -0,0 +1,127 @@
+package naming
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// fileInstance is the on-disk shape of a single instance entry in a file
+// backend's source file.
+type fileInstance struct {
+	AppID    string            `json:"appid" yaml:"appid"`
+	Zone     string            `json:"zone" yaml:"zone"`
+	Addrs    []string          `json:"addrs" yaml:"addrs"`
+	Color    string            `json:"color" yaml:"color"`
+	Version  string            `json:"version" yaml:"version"`
+	Metadata map[string]string `json:"metadata" yaml:"metadata"`
+}
+
+// fileBackend is a read-only Backend serving a static list of instances
+// loaded once from a YAML or JSON file, useful in tests and local dev.
+type fileBackend struct {
+	mutex sync.RWMutex
+	apps  map[string]*appInfo
+}
+
+// NewFileBackend returns a Backend that serves a static list of instances
+// read from the YAML or JSON file at path (selected by its extension: any
+// suffix other than ".json" is parsed as YAML). Register is not supported;
+// it always fails with ErrRegisterUnsupported.
+func NewFileBackend(path string) (Backend, error) {
+	b := &fileBackend{apps: map[string]*appInfo{}}
+	if err := b.load(path); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *fileBackend) load(path string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var entries []fileInstance
+	if strings.HasSuffix(path, ".json") {
+		err = json.Unmarshal(raw, &entries)
+	} else {
+		err = yaml.Unmarshal(raw, &entries)
+	}
+	if err != nil {
+		return err
+	}
+	zones := map[string]map[string][]*Instance{}
+	for _, e := range entries {
+		if zones[e.AppID] == nil {
+			zones[e.AppID] = map[string][]*Instance{}
+		}
+		zones[e.AppID][e.Zone] = append(zones[e.AppID][e.Zone], &Instance{
+			AppID:    e.AppID,
+			Zone:     e.Zone,
+			Addrs:    e.Addrs,
+			Color:    e.Color,
+			Version:  e.Version,
+			Metadata: e.Metadata,
+		})
+	}
+	for appID, zoneIns := range zones {
+		app := &appInfo{}
+		app.zoneIns.Store(zoneIns)
+		b.apps[appID] = app
+	}
+	return nil
+}
+
+// Fetch returns the latest discovered instances by appID.
+func (b *fileBackend) Fetch(appID string) (ins map[string][]*Instance, ok bool) {
+	b.mutex.RLock()
+	app, ok := b.apps[appID]
+	b.mutex.RUnlock()
+	if ok {
+		ins, ok = app.zoneIns.Load().(map[string][]*Instance)
+	}
+	return
+}
+
+// Watch watches appID. Since the backing file is only read once, the
+// returned chan never fires past its initial (empty) state.
+func (b *fileBackend) Watch(appID string) <-chan struct{} {
+	b.mutex.RLock()
+	app, ok := b.apps[appID]
+	b.mutex.RUnlock()
+	if !ok {
+		app = &appInfo{}
+		app.zoneIns.Store(map[string][]*Instance{})
+		b.mutex.Lock()
+		b.apps[appID] = app
+		b.mutex.Unlock()
+	}
+	return app.subscribe()
+}
+
+// Unwatch unwatch app changes.
+func (b *fileBackend) Unwatch(appID string) {
+	b.mutex.Lock()
+	app, ok := b.apps[appID]
+	if ok {
+		delete(b.apps, appID)
+	}
+	b.mutex.Unlock()
+	if ok {
+		app.closeAll()
+	}
+}
+
+// Register is not supported by the static file backend.
+func (b *fileBackend) Register(ins *Instance) (cancelFunc context.CancelFunc, err error) {
+	return nil, ErrRegisterUnsupported
+}
+
+// Close is a no-op; the file backend holds no background goroutines.
+func (b *fileBackend) Close() error {
+	return nil
+}
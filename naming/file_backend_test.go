@@ -0,0 +1,55 @@
+package naming_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Bilibili/discovery/naming"
+)
+
+// TestFileBackendFetchWatch is a round-trip test for NewFileBackend: Fetch
+// returns what was in the source file, and Watch returns a usable chan
+// without blocking (the file backend never fires it again, since the
+// source file is only read once).
+func TestFileBackendFetchWatch(t *testing.T) {
+	f, err := ioutil.TempFile("", "discovery-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(`
+- appid: provider
+  zone: sh1
+  addrs: ["127.0.0.1:8080"]
+  color: red
+  version: "1.0"
+`); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err := naming.NewFileBackend(f.Name())
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+	defer backend.Close()
+
+	ins, ok := backend.Fetch("provider")
+	if !ok {
+		t.Fatal(`Fetch("provider") ok = false, want true`)
+	}
+	if got := ins["sh1"]; len(got) != 1 || got[0].Addrs[0] != "127.0.0.1:8080" {
+		t.Errorf(`Fetch("provider") = %+v, want one instance at 127.0.0.1:8080`, ins)
+	}
+
+	if ch := backend.Watch("provider"); ch == nil {
+		t.Error(`Watch("provider") = nil, want a usable chan`)
+	}
+
+	if _, ok := backend.Fetch("nobody"); ok {
+		t.Error(`Fetch("nobody") ok = true, want false for an unregistered appID`)
+	}
+}
@@ -0,0 +1,19 @@
+package naming
+
+// ColorFilter matches instances whose Color equals color.
+func ColorFilter(color string) func(in *Instance) bool {
+	return func(in *Instance) bool { return in.Color == color }
+}
+
+// VersionFilter matches instances whose Version is >= version, compared
+// lexicographically (the "x.y.z" versions discovery instances already
+// register with sort the same lexicographically as numerically, as long
+// as every segment has the same width).
+func VersionFilter(version string) func(in *Instance) bool {
+	return func(in *Instance) bool { return in.Version >= version }
+}
+
+// MetadataEqualsFilter matches instances whose metadata[key] == value.
+func MetadataEqualsFilter(key, value string) func(in *Instance) bool {
+	return func(in *Instance) bool { return in.Metadata[key] == value }
+}
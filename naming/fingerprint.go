@@ -0,0 +1,23 @@
+package naming
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// fingerprint computes a stable hash over the sorted addrs of ins, so
+// callers can cheaply detect whether a candidate set actually changed
+// without deep-comparing every Instance.
+func fingerprint(ins []*Instance) uint64 {
+	addrs := make([]string, 0, len(ins))
+	for _, in := range ins {
+		addrs = append(addrs, in.Addrs...)
+	}
+	sort.Strings(addrs)
+	h := fnv.New64a()
+	for _, a := range addrs {
+		h.Write([]byte(a))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,162 @@
+package naming
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/Bilibili/discovery/naming/discoverypb"
+	log "github.com/golang/glog"
+	"google.golang.org/grpc"
+)
+
+// grpcServerproc is the gRPC counterpart of serverproc: it drives the same
+// apps/broadcast plumbing as the HTTP transport, but is fed by a
+// server-streaming Polls RPC instead of repeated HTTP GETs to
+// /discovery/polls. Node discovery still goes through the HTTP
+// /discovery/nodes endpoint; only the polling leg is replaced.
+func (b *httpBackend) grpcServerproc(ctx context.Context) {
+	var (
+		retry int
+		nodes []string
+		idx   uint64
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case app := <-b.delete:
+			app.closeAll()
+		default:
+		}
+		if len(nodes) == 0 {
+			tnodes := b.nodes(ctx)
+			if len(tnodes) == 0 {
+				time.Sleep(time.Second)
+				retry++
+				continue
+			}
+			retry = 0
+			nodes = tnodes
+			shuffle(len(nodes), func(i, j int) {
+				nodes[i], nodes[j] = nodes[j], nodes[i]
+			})
+		}
+		host := nodes[int(idx%uint64(len(nodes)))]
+		b.mutex.RLock()
+		grpcPort := b.c.GRPCPort
+		b.mutex.RUnlock()
+		addr, err := grpcAddr(host, grpcPort)
+		if err != nil {
+			log.Errorf("discovery: grpc address(%s, port:%s) error(%v)", host, grpcPort, err)
+			idx++
+			nodes = nil
+			time.Sleep(time.Second)
+			retry++
+			continue
+		}
+		// streamCtx is canceled either by ctx itself or by a concurrent
+		// notify, so a newly watched appID reopens the stream with the
+		// updated appID list instead of waiting for the old one to end.
+		streamCtx, cancel := context.WithCancel(ctx)
+		waited := make(chan struct{})
+		go func() {
+			select {
+			case <-b.notify:
+				cancel()
+			case <-waited:
+			}
+		}()
+		err = b.grpcPolls(streamCtx, addr)
+		cancel()
+		close(waited)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if streamCtx.Err() == context.Canceled {
+				continue
+			}
+			log.Errorf("discovery: grpc polls(%s) error(%v)", addr, err)
+			idx++
+			nodes = nil
+			time.Sleep(time.Second)
+			retry++
+			continue
+		}
+	}
+}
+
+// grpcAddr maps a discovery node's HTTP address, as returned by
+// /discovery/nodes, to its gRPC Polls address: the node list only ever
+// advertises the HTTP port, so this keeps the node's host and substitutes
+// Config.GRPCPort for the port.
+func grpcAddr(httpAddr, grpcPort string) (string, error) {
+	host, _, err := net.SplitHostPort(httpAddr)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, grpcPort), nil
+}
+
+// grpcPolls opens a Polls stream against addr for the currently watched
+// appIDs, and feeds every pushed delta into broadcast until the stream
+// ends or ctx is canceled. If nothing is watched yet, it waits on ctx
+// instead of dialing, so grpcServerproc doesn't spin on repeated empty
+// polls while the watch set is empty.
+func (b *httpBackend) grpcPolls(ctx context.Context, addr string) error {
+	b.mutex.RLock()
+	c := b.c
+	req := &discoverypb.PollsRequest{Zone: c.Zone, Env: c.Env, Hostname: c.Host}
+	for appID, app := range b.apps {
+		req.AppId = append(req.AppId, appID)
+		req.LatestTimestamp = append(req.LatestTimestamp, atomic.LoadInt64(&app.lastTs))
+	}
+	b.mutex.RUnlock()
+	if len(req.AppId) == 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client := discoverypb.NewDiscoveryClient(conn)
+
+	stream, err := client.Polls(ctx, req)
+	if err != nil {
+		return err
+	}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		b.broadcast(map[string]appData{resp.AppId: pbToAppData(resp.Data)})
+	}
+}
+
+// pbToAppData converts a discoverypb.AppData pushed over the wire into the
+// appData shape broadcast() already knows how to fan out to watchers.
+func pbToAppData(d *discoverypb.AppData) appData {
+	ad := appData{ZoneInstances: map[string][]*Instance{}, LastTs: d.LatestTimestamp}
+	for zone, zi := range d.ZoneInstances {
+		ins := make([]*Instance, 0, len(zi.Instances))
+		for _, pi := range zi.Instances {
+			ins = append(ins, &Instance{
+				AppID:    pi.AppId,
+				Zone:     pi.Zone,
+				Env:      pi.Env,
+				Addrs:    pi.Addrs,
+				Color:    pi.Color,
+				Version:  pi.Version,
+				Metadata: pi.Metadata,
+			})
+		}
+		ad.ZoneInstances[zone] = ins
+	}
+	return ad
+}
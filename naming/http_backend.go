@@ -0,0 +1,645 @@
+package naming
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ecode "github.com/Bilibili/discovery/errors"
+	"github.com/Bilibili/discovery/lib/http"
+	xtime "github.com/Bilibili/discovery/lib/time"
+	log "github.com/golang/glog"
+)
+
+const (
+	_registerURL = "http://%s/discovery/register"
+	_cancelURL   = "http://%s/discovery/cancel"
+	_renewURL    = "http://%s/discovery/renew"
+
+	_pollURL  = "http://%s/discovery/polls"
+	_nodesURL = "http://%s/discovery/nodes"
+
+	_registerGap = 30 * time.Second
+
+	_statusUP = "1"
+
+	_errCodeOK = 0
+	_errCodeNF = -404
+)
+
+type appData struct {
+	ZoneInstances map[string][]*Instance `json:"zone_instances"`
+	LastTs        int64                  `json:"latest_timestamp"`
+}
+
+type appInfo struct {
+	subsMu  sync.Mutex
+	subs    []chan struct{} // one per outstanding Watch call, fanned out by notify
+	zoneIns atomic.Value
+	lastTs  int64 // atomic; latest timestamp, read by discovery.cacheflush concurrently with polls/broadcast
+	stale   int32 // atomic; 1 while zoneIns came from Config.CacheFile, not a live poll
+}
+
+// subscribe registers and returns a new per-caller channel that notify
+// fans updates out to. Watch calls it once per invocation so that two
+// watchers of the same appID -- e.g. a caller's own Watch loop and a
+// WatchFilter built on top of it -- each see every update instead of
+// racing to consume a single shared channel.
+func (a *appInfo) subscribe() chan struct{} {
+	ch := make(chan struct{}, 1)
+	a.subsMu.Lock()
+	a.subs = append(a.subs, ch)
+	a.subsMu.Unlock()
+	return ch
+}
+
+// notify fans an update out to every subscriber channel, non-blocking so
+// a slow or absent reader can't stall broadcast.
+func (a *appInfo) notify() {
+	a.subsMu.Lock()
+	for _, ch := range a.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	a.subsMu.Unlock()
+}
+
+// closeAll closes every subscriber channel, once appID is fully Unwatch'd.
+func (a *appInfo) closeAll() {
+	a.subsMu.Lock()
+	for _, ch := range a.subs {
+		close(ch)
+	}
+	a.subs = nil
+	a.subsMu.Unlock()
+}
+
+// httpBackend is the default Backend: it polls the bilibili discovery
+// cluster over HTTP and registers/renews instances against it.
+type httpBackend struct {
+	c          *Config
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	httpClient *http.Client
+
+	mutex    sync.RWMutex
+	apps     map[string]*appInfo
+	registry map[string]struct{}
+	lastHost string
+
+	// notify wakes the poller supervisor (discovery.poller) when the
+	// watch set changes, so a newly Watch'd appID doesn't wait out a
+	// stale poll cycle. started guards it against being spawned twice.
+	notify  chan struct{}
+	started int32
+
+	// cacheFile is Config.CacheFile; flushNotify wakes the cache flusher
+	// (discovery.cacheflush) whenever broadcast updates an app, coalesced
+	// to at most one write per second.
+	cacheFile   string
+	flushNotify chan struct{}
+
+	delete chan *appInfo
+	wg     sync.WaitGroup
+}
+
+// newHTTPBackend new a Backend that polls the discovery cluster over HTTP,
+// or over gRPC when c.Transport == "grpc".
+func newHTTPBackend(c *Config) *httpBackend {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &httpBackend{
+		c:           c,
+		ctx:         ctx,
+		cancelFunc:  cancel,
+		apps:        map[string]*appInfo{},
+		registry:    map[string]struct{}{},
+		notify:      make(chan struct{}, 1),
+		cacheFile:   c.CacheFile,
+		flushNotify: make(chan struct{}, 1),
+		delete:      make(chan *appInfo, 10),
+	}
+
+	cfg := &http.ClientConfig{
+		Dial:      xtime.Duration(3 * time.Second),
+		KeepAlive: xtime.Duration(40 * time.Second),
+	}
+	b.httpClient = http.NewClient(cfg)
+	b.loadCache()
+	return b
+}
+
+// Fetch returns the latest discovered instances by appID
+func (b *httpBackend) Fetch(appID string) (ins map[string][]*Instance, ok bool) {
+	b.mutex.RLock()
+	app, ok := b.apps[appID]
+	b.mutex.RUnlock()
+	if ok {
+		ins, ok = app.zoneIns.Load().(map[string][]*Instance)
+	}
+	return
+}
+
+// FetchWithMeta is like Fetch, but additionally reports whether ins came
+// from Config.CacheFile rather than a live poll -- it's stale until the
+// first successful broadcast for appID.
+func (b *httpBackend) FetchWithMeta(appID string) (ins map[string][]*Instance, stale bool, ok bool) {
+	b.mutex.RLock()
+	app, ok := b.apps[appID]
+	b.mutex.RUnlock()
+	if !ok {
+		return nil, false, false
+	}
+	ins, ok = app.zoneIns.Load().(map[string][]*Instance)
+	stale = atomic.LoadInt32(&app.stale) == 1
+	return
+}
+
+// Unwatch unwatch app changes.
+func (b *httpBackend) Unwatch(appID string) {
+	b.mutex.Lock()
+	app, ok := b.apps[appID]
+	if ok {
+		delete(b.apps, appID)
+	}
+	b.mutex.Unlock()
+	if ok {
+		b.delete <- app
+	}
+}
+
+// Watch watch the change of app instances by appID and return a chan to notify the instance change
+func (b *httpBackend) Watch(appID string) <-chan struct{} {
+	b.mutex.RLock()
+	app, ok := b.apps[appID]
+	b.mutex.RUnlock()
+	if !ok {
+		app = &appInfo{}
+		b.mutex.Lock()
+		b.apps[appID] = app
+		b.mutex.Unlock()
+		log.Infof("disocvery: AddWatch(%s)", appID)
+		select {
+		case b.notify <- struct{}{}:
+		default:
+		}
+	}
+	b.ensureRun()
+	return app.subscribe()
+}
+
+// Run starts the poller supervisor (discovery.poller) under ctx and blocks
+// until ctx is canceled. Callers who don't call Run explicitly get the
+// same poller started lazily, against a background context, on their
+// first Watch or Register call. Once ctx is done, Run stops the backend's
+// goroutines as Close does and waits for them before returning.
+func (b *httpBackend) Run(ctx context.Context) error {
+	b.ensureRun()
+	<-ctx.Done()
+	b.cancelFunc()
+	b.wg.Wait()
+	return ctx.Err()
+}
+
+// ensureRun starts the poller supervisor, and the cache flusher when
+// Config.CacheFile is set, exactly once.
+func (b *httpBackend) ensureRun() {
+	if atomic.CompareAndSwapInt32(&b.started, 0, 1) {
+		b.wg.Add(1)
+		go b.poller(b.ctx)
+		if b.cacheFile != "" {
+			b.wg.Add(1)
+			go b.cacheflush(b.ctx)
+		}
+	}
+}
+
+// poller is the discovery.poller goroutine: it runs the HTTP or gRPC
+// serverproc loop, whichever Config.Transport selects, until ctx is done.
+func (b *httpBackend) poller(ctx context.Context) {
+	defer b.wg.Done()
+	log.Infof("discovery.poller: starting")
+	if b.c.Transport == "grpc" {
+		b.grpcServerproc(ctx)
+	} else {
+		b.serverproc(ctx)
+	}
+	log.Infof("discovery.poller: stopped")
+}
+
+// Reload reload the config
+func (b *httpBackend) Reload(c *Config) {
+	b.mutex.Lock()
+	b.c = c
+	b.mutex.Unlock()
+}
+
+// Zone returns the zone this backend was configured with, so Pick can
+// default its zone-affinity filter without callers repeating Config.Zone.
+func (b *httpBackend) Zone() string {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.c.Zone
+}
+
+// Close stop all running process including discovery and register, and
+// waits for them to exit before returning.
+func (b *httpBackend) Close() error {
+	b.cancelFunc()
+	b.wg.Wait()
+	return nil
+}
+
+// Register Register an instance with discovery and renew automatically
+func (b *httpBackend) Register(ins *Instance) (cancelFunc context.CancelFunc, err error) {
+	b.mutex.Lock()
+	if _, ok := b.registry[ins.AppID]; ok {
+		err = ErrDuplication
+	} else {
+		b.registry[ins.AppID] = struct{}{}
+	}
+	b.mutex.Unlock()
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(b.ctx)
+	if err = b.register(ctx, ins); err != nil {
+		b.mutex.Lock()
+		delete(b.registry, ins.AppID)
+		b.mutex.Unlock()
+		cancel()
+		return
+	}
+	ch := make(chan struct{}, 1)
+	cancelFunc = context.CancelFunc(func() {
+		cancel()
+		<-ch
+	})
+	b.wg.Add(1)
+	go b.renewproc(ctx, ins, ch)
+	return
+}
+
+// renewproc is the discovery.register:<appid> goroutine: it renews ins on
+// a fixed interval until ctx is done, then cancels the registration.
+func (b *httpBackend) renewproc(ctx context.Context, ins *Instance, done chan struct{}) {
+	defer b.wg.Done()
+	log.Infof("discovery.register:%s: starting", ins.AppID)
+	ticker := time.NewTicker(_registerGap)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.renew(ctx, ins); err != nil && ecode.NothingFound.Equal(err) {
+				b.register(ctx, ins)
+			}
+		case <-ctx.Done():
+			b.cancel(ins)
+			done <- struct{}{}
+			log.Infof("discovery.register:%s: stopped", ins.AppID)
+			return
+		}
+	}
+}
+
+// cancel Remove the registered instance from discovery
+func (b *httpBackend) cancel(ins *Instance) (err error) {
+	b.mutex.RLock()
+	c := b.c
+	b.mutex.RUnlock()
+
+	res := new(struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	})
+	uri := fmt.Sprintf(_cancelURL, c.Domain)
+	params := b.newParams(c)
+	params.Set("appid", ins.AppID)
+	// request
+	if err = b.httpClient.Post(context.TODO(), uri, "", params, &res); err != nil {
+		log.Errorf("discovery cancel client.Get(%v) env(%s) appid(%s) hostname(%s) error(%v)",
+			uri, c.Env, ins.AppID, c.Host, err)
+		return
+	}
+	if ec := ecode.Int(res.Code); !ec.Equal(ecode.OK) {
+		log.Warningf("discovery cancel client.Get(%v)  env(%s) appid(%s) hostname(%s) code(%v)",
+			uri, c.Env, ins.AppID, c.Host, res.Code)
+		err = ec
+		return
+	}
+	log.Infof("discovery cancel client.Get(%v)  env(%s) appid(%s) hostname(%s) success",
+		uri, c.Env, ins.AppID, c.Host)
+	return
+}
+
+// register Register an instance with discovery
+func (b *httpBackend) register(ctx context.Context, ins *Instance) (err error) {
+	b.mutex.RLock()
+	c := b.c
+	b.mutex.RUnlock()
+
+	var metadata []byte
+	if ins.Metadata != nil {
+		if metadata, err = json.Marshal(ins.Metadata); err != nil {
+			log.Errorf("discovery:register instance Marshal metadata(%v) failed!error(%v)", ins.Metadata, err)
+		}
+	}
+	res := new(struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	})
+	uri := fmt.Sprintf(_registerURL, c.Domain)
+	params := b.newParams(c)
+	params.Set("appid", ins.AppID)
+	params.Set("addrs", strings.Join(ins.Addrs, ","))
+	params.Set("color", ins.Color)
+	params.Set("version", ins.Version)
+	params.Set("status", _statusUP)
+	params.Set("metadata", string(metadata))
+	if err = b.httpClient.Post(ctx, uri, "", params, &res); err != nil {
+		log.Errorf("discovery: register client.Get(%v)  zone(%s) env(%s) appid(%s) addrs(%v) color(%s) error(%v)",
+			uri, c.Zone, c.Env, ins.AppID, ins.Addrs, ins.Color, err)
+		return
+	}
+	if ec := ecode.Int(res.Code); !ec.Equal(ecode.OK) {
+		log.Warningf("discovery: register client.Get(%v)  env(%s) appid(%s) addrs(%v) color(%s)  code(%v)",
+			uri, c.Env, ins.AppID, ins.Addrs, ins.Color, res.Code)
+		err = ec
+		return
+	}
+	log.Infof("discovery: register client.Get(%v) env(%s) appid(%s) addrs(%s) color(%s) success",
+		uri, c.Env, ins.AppID, ins.Addrs, ins.Color)
+	return
+}
+
+// renew Renew an instance with discovery
+func (b *httpBackend) renew(ctx context.Context, ins *Instance) (err error) {
+	b.mutex.RLock()
+	c := b.c
+	b.mutex.RUnlock()
+
+	res := new(struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	})
+	uri := fmt.Sprintf(_renewURL, c.Domain)
+	params := b.newParams(c)
+	params.Set("appid", ins.AppID)
+	if err = b.httpClient.Post(ctx, uri, "", params, &res); err != nil {
+		log.Errorf("discovery: renew client.Get(%v)  env(%s) appid(%s) hostname(%s) error(%v)",
+			uri, c.Env, ins.AppID, c.Host, err)
+		return
+	}
+	if ec := ecode.Int(res.Code); !ec.Equal(ecode.OK) {
+		err = ec
+		if ec.Equal(ecode.NothingFound) {
+			return
+		}
+		log.Errorf("discovery: renew client.Get(%v) env(%s) appid(%s) hostname(%s) code(%v)",
+			uri, c.Env, ins.AppID, c.Host, res.Code)
+		return
+	}
+	return
+}
+
+// serverproc is the HTTP long-polling loop driven by the discovery.poller
+// goroutine. It re-fetches the node list on its own ticker, or when notify
+// fires (a new appID was added to the watch set) between polls; a notify
+// that arrives during a poll instead interrupts it, so the next poll
+// carries the new watch set. Otherwise it keeps polling the current node
+// for deltas until ctx is done.
+func (b *httpBackend) serverproc(ctx context.Context) {
+	var (
+		retry  int
+		update bool
+		nodes  []string
+		idx    uint64
+	)
+	ticker := time.NewTicker(time.Minute * 30)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			update = true
+		case <-b.notify:
+			update = true
+		case app := <-b.delete:
+			app.closeAll()
+		default:
+		}
+		if len(nodes) == 0 || update {
+			update = false
+			tnodes := b.nodes(ctx)
+			if len(tnodes) == 0 {
+				time.Sleep(time.Second)
+				retry++
+				continue
+			}
+			retry = 0
+			nodes = tnodes
+			// FIXME: we should use rand.Shuffle() in golang 1.10
+			shuffle(len(nodes), func(i, j int) {
+				nodes[i], nodes[j] = nodes[j], nodes[i]
+			})
+		}
+		// pollCtx is canceled either by ctx itself or by a concurrent
+		// notify, so a newly watched appID interrupts an in-flight poll
+		// instead of waiting for it to time out.
+		pollCtx, cancel := context.WithCancel(ctx)
+		waited := make(chan struct{})
+		go func() {
+			select {
+			case <-b.notify:
+				cancel()
+			case <-waited:
+			}
+		}()
+		apps, err := b.polls(pollCtx, nodes[int(idx%uint64(len(nodes)))])
+		cancel()
+		close(waited)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if pollCtx.Err() == context.Canceled {
+				continue
+			}
+			idx++
+			time.Sleep(time.Second)
+			retry++
+			continue
+		}
+		retry = 0
+		b.broadcast(apps)
+	}
+}
+
+func (b *httpBackend) nodes(ctx context.Context) (nodes []string) {
+	b.mutex.RLock()
+	c := b.c
+	b.mutex.RUnlock()
+
+	res := new(struct {
+		Code int `json:"code"`
+		Data []struct {
+			Addr string `json:"addr"`
+		} `json:"data"`
+	})
+	uri := fmt.Sprintf(_nodesURL, c.Domain)
+	if err := b.httpClient.Get(ctx, uri, "", nil, res); err != nil {
+		log.Errorf("discovery: consumer client.Get(%v)error(%+v)", uri, err)
+		return
+	}
+	if ec := ecode.Int(res.Code); !ec.Equal(ecode.OK) {
+		log.Errorf("discovery: consumer client.Get(%v) error(%v)", uri, res.Code)
+		return
+	}
+	if len(res.Data) == 0 {
+		log.Warningf("discovery: get nodes(%s) failed,no nodes found!", uri)
+		return
+	}
+	nodes = make([]string, 0, len(res.Data))
+	for i := range res.Data {
+		nodes = append(nodes, res.Data[i].Addr)
+	}
+	return
+}
+
+func (b *httpBackend) polls(ctx context.Context, host string) (apps map[string]appData, err error) {
+	var (
+		lastTss []int64
+		appIDs  []string
+		changed bool
+	)
+	if host != b.lastHost {
+		b.lastHost = host
+		changed = true
+	}
+	b.mutex.RLock()
+	c := b.c
+	for k, v := range b.apps {
+		if changed {
+			atomic.StoreInt64(&v.lastTs, 0)
+		}
+		appIDs = append(appIDs, k)
+		lastTss = append(lastTss, atomic.LoadInt64(&v.lastTs))
+	}
+	b.mutex.RUnlock()
+	if len(appIDs) == 0 {
+		return
+	}
+	uri := fmt.Sprintf(_pollURL, host)
+	res := new(struct {
+		Code int                `json:"code"`
+		Data map[string]appData `json:"data"`
+	})
+	params := url.Values{}
+	params.Set("env", c.Env)
+	params.Set("hostname", c.Host)
+	for _, appid := range appIDs {
+		params.Add("appid", appid)
+	}
+	for _, ts := range lastTss {
+		params.Add("latest_timestamp", strconv.FormatInt(ts, 10))
+	}
+	if err = b.httpClient.Get(ctx, uri, "", params, res); err != nil {
+		log.Errorf("discovery: client.Get(%s) error(%+v)", uri+"?"+params.Encode(), err)
+		return
+	}
+	if ec := ecode.Int(res.Code); !ec.Equal(ecode.OK) {
+		if !ec.Equal(ecode.NotModified) {
+			log.Errorf("discovery: client.Get(%s) get error code(%d)", uri+"?"+params.Encode(), res.Code)
+			err = ec
+		}
+		return
+	}
+	info, _ := json.Marshal(res.Data)
+	for _, app := range res.Data {
+		if app.LastTs == 0 {
+			err = ecode.ServerErr
+			log.Errorf("discovery: client.Get(%s) latest_timestamp is 0,instances:(%s)", uri+"?"+params.Encode(), info)
+			return
+		}
+	}
+	log.Infof("discovery: successfully polls(%s) instances (%s)", uri+"?"+params.Encode(), info)
+	apps = res.Data
+	return
+}
+
+func (b *httpBackend) broadcast(apps map[string]appData) {
+	var changed bool
+	for appID, v := range apps {
+		var count int
+		for zone, ins := range v.ZoneInstances {
+			if len(ins) == 0 {
+				delete(v.ZoneInstances, zone)
+			}
+			count += len(ins)
+		}
+		if count == 0 {
+			continue
+		}
+		b.mutex.RLock()
+		app, ok := b.apps[appID]
+		b.mutex.RUnlock()
+		if ok {
+			atomic.StoreInt64(&app.lastTs, v.LastTs)
+			app.zoneIns.Store(v.ZoneInstances)
+			atomic.StoreInt32(&app.stale, 0)
+			changed = true
+			app.notify()
+		}
+	}
+	if changed && b.cacheFile != "" {
+		select {
+		case b.flushNotify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *httpBackend) newParams(c *Config) url.Values {
+	params := url.Values{}
+	params.Set("zone", c.Zone)
+	params.Set("env", c.Env)
+	params.Set("hostname", c.Host)
+	return params
+}
+
+var r = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// shuffle pseudo-randomizes the order of elements.
+// n is the number of elements. Shuffle panics if n < 0.
+// swap swaps the elements with indexes i and j.
+func shuffle(n int, swap func(i, j int)) {
+	if n < 0 {
+		panic("invalid argument to Shuffle")
+	}
+
+	// Fisher-Yates shuffle: https://en.wikipedia.org/wiki/Fisher%E2%80%93Yates_shuffle
+	// Shuffle really ought not be called with n that doesn't fit in 32 bits.
+	// Not only will it take a very long time, but with 2³¹! possible permutations,
+	// there's no way that any PRNG can have a big enough internal state to
+	// generate even a minuscule percentage of the possible permutations.
+	// Nevertheless, the right API signature accepts an int n, so handle it as best we can.
+	i := n - 1
+	for ; i > 1<<31-1-1; i-- {
+		j := int(r.Int63n(int64(i + 1)))
+		swap(i, j)
+	}
+	for ; i > 0; i-- {
+		j := int(r.Int31n(int32(i + 1)))
+		swap(i, j)
+	}
+}
@@ -0,0 +1,68 @@
+package naming
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrRegisterUnsupported is returned by Backend implementations that are
+// read-only, e.g. NewDNSBackend and NewFileBackend.
+var ErrRegisterUnsupported = errors.New("discovery: backend does not support Register")
+
+// Resolver is the read side of a naming Backend: given an appID it returns
+// the currently known instances, grouped by zone, and lets callers watch
+// for changes.
+type Resolver interface {
+	// Fetch returns the latest discovered instances by appID.
+	Fetch(appID string) (ins map[string][]*Instance, ok bool)
+	// Watch watches the change of app instances by appID and returns a chan
+	// to notify the instance change.
+	Watch(appID string) <-chan struct{}
+	// Unwatch unwatch app changes.
+	Unwatch(appID string)
+}
+
+// Registry is the write side of a naming Backend: it lets an instance
+// announce itself and keeps it alive until the returned cancelFunc is
+// called.
+type Registry interface {
+	// Register registers ins with the backend and renews it automatically
+	// until cancelFunc is called.
+	Register(ins *Instance) (cancelFunc context.CancelFunc, err error)
+}
+
+// Backend is the pluggable transport behind Discovery: it is both a
+// Resolver and a Registry, plus lifecycle management via Close.
+//
+// Built-in backends are the default HTTP long-polling transport used by
+// New, NewDNSBackend for interop with Kubernetes headless services / Consul
+// DNS, and NewFileBackend for tests and local dev. Swapping backends via
+// NewWithBackend lets a process participate in mixed environments where
+// some upstreams are registered with the bilibili discovery cluster and
+// others live in Kubernetes/Consul or a local file, without any change to
+// consumer code written against Resolver/Registry.
+type Backend interface {
+	Resolver
+	Registry
+	Close() error
+}
+
+// Reloadable is implemented by backends that support runtime config
+// changes, e.g. the default HTTP backend.
+type Reloadable interface {
+	Reload(c *Config)
+}
+
+// Runnable is implemented by backends that expose explicit lifecycle
+// management, e.g. the default HTTP backend. Run starts the backend's
+// long-running goroutines under ctx and blocks until ctx is done.
+type Runnable interface {
+	Run(ctx context.Context) error
+}
+
+// CacheAware is implemented by backends that can report whether their
+// last Fetch came from an on-disk cache rather than a live poll, e.g. the
+// default HTTP backend when Config.CacheFile is set.
+type CacheAware interface {
+	FetchWithMeta(appID string) (ins map[string][]*Instance, stale bool, ok bool)
+}
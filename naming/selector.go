@@ -0,0 +1,122 @@
+package naming
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrNoInstance is returned by Pick when no candidate instance is
+// available for the given appID, e.g. nothing registered, or a zone
+// filter excluded everything.
+var ErrNoInstance = errors.New("discovery: no available instance")
+
+// Selector picks one Instance out of a set of candidates for appID,
+// according to whatever load-balancing policy it implements. key is the
+// value passed via WithHashKey; selectors that don't need one ignore it.
+//
+// done, if non-nil, must be called once the caller is finished using the
+// picked instance; selectors that track in-flight load (e.g. LeastConn)
+// use it to decrement their counters.
+type Selector interface {
+	Pick(appID string, ins []*Instance, key string) (in *Instance, done func(), err error)
+}
+
+// ZoneAware is implemented by backends that know their own zone, so Pick
+// can default its zone-affinity filter to it without the caller repeating
+// Config.Zone via WithZone.
+type ZoneAware interface {
+	Zone() string
+}
+
+// _defaultSelector is the RoundRobin shared by every Pick call that doesn't
+// pass WithSelector, so its per-appID rotation carries over between calls.
+var _defaultSelector = RoundRobin()
+
+type pickOptions struct {
+	selector Selector
+	zone     string
+	key      string
+}
+
+// PickOption configures Discovery.Pick.
+type PickOption func(*pickOptions)
+
+// WithSelector overrides the Selector used for this Pick call; the
+// default is RoundRobin.
+func WithSelector(s Selector) PickOption {
+	return func(o *pickOptions) { o.selector = s }
+}
+
+// WithZone restricts Pick to candidates in zone, falling back to every
+// zone when zone has no instances. It defaults to the backend's Zone()
+// when the backend implements ZoneAware.
+func WithZone(zone string) PickOption {
+	return func(o *pickOptions) { o.zone = zone }
+}
+
+// WithHashKey sets the key ConsistentHash hashes to choose an instance.
+// It is ignored by every other built-in Selector.
+func WithHashKey(key string) PickOption {
+	return func(o *pickOptions) { o.key = key }
+}
+
+// Pick returns one Instance for appID, chosen by the given Selector (round
+// robin by default). Candidates are first restricted to the pick's zone,
+// falling back to every zone when that's empty -- the zone-affinity
+// pattern every ExampleDiscovery_Watch consumer used to hand-roll in its
+// own getInstance. done is always non-nil on success, even for selectors
+// that don't track in-flight load, so callers can unconditionally
+// `defer done()`.
+func (d *Discovery) Pick(appID string, opts ...PickOption) (in *Instance, done func(), err error) {
+	o := pickOptions{selector: _defaultSelector}
+	if za, ok := d.Backend.(ZoneAware); ok {
+		o.zone = za.Zone()
+	} else {
+		o.zone = d.zone
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	zoneIns, ok := d.Fetch(appID)
+	if !ok {
+		return nil, nil, ErrNoInstance
+	}
+	candidates := zoneFilter(zoneIns, o.zone)
+	if len(candidates) == 0 {
+		return nil, nil, ErrNoInstance
+	}
+	in, done, err = o.selector.Pick(appID, candidates, o.key)
+	if done == nil {
+		done = func() {}
+	}
+	return in, done, err
+}
+
+// zoneFilter restricts ins to zone, falling back to every zone when zone
+// is unset or has no instances. The cross-zone fallback is sorted by addr
+// so order-sensitive selectors like RoundRobin see a stable candidate
+// order across calls instead of one reshuffled by Go's randomized map
+// iteration.
+func zoneFilter(ins map[string][]*Instance, zone string) []*Instance {
+	if zone != "" {
+		if zoneIns, ok := ins[zone]; ok && len(zoneIns) > 0 {
+			return zoneIns
+		}
+	}
+	var all []*Instance
+	for _, zoneIns := range ins {
+		all = append(all, zoneIns...)
+	}
+	sort.Slice(all, func(i, j int) bool { return instanceAddr(all[i]) < instanceAddr(all[j]) })
+	return all
+}
+
+// instanceAddr returns the address a Selector keys its per-instance state
+// on. Instances always have at least one addr by the time they come out
+// of Fetch.
+func instanceAddr(in *Instance) string {
+	if len(in.Addrs) > 0 {
+		return in.Addrs[0]
+	}
+	return in.AppID
+}
@@ -0,0 +1,74 @@
+package naming
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+const _hashReplicas = 100
+
+// consistentHash picks a candidate by hashing the caller-supplied key onto
+// a ring built from the candidates' addrs, so repeated Picks with the same
+// key land on the same instance as long as the candidate set is stable.
+// The ring is cached per appID and rebuilt only when a Pick's candidates
+// differ from the ones it was built from (detected via fingerprint); the
+// selector does not subscribe to Watch itself.
+type consistentHash struct {
+	mutex sync.Mutex
+	rings map[string]*hashRing // appID -> cached ring
+}
+
+type hashRing struct {
+	fp      uint64
+	entries []hashRingEntry
+}
+
+type hashRingEntry struct {
+	hash uint32
+	in   *Instance
+}
+
+// ConsistentHash returns a Selector that hashes WithHashKey's key onto a
+// ring built from the candidate addrs, for callers that want sticky
+// routing (e.g. session affinity).
+func ConsistentHash() Selector {
+	return &consistentHash{rings: map[string]*hashRing{}}
+}
+
+func (s *consistentHash) Pick(appID string, ins []*Instance, key string) (in *Instance, done func(), err error) {
+	fp := fingerprint(ins)
+	s.mutex.Lock()
+	ring, ok := s.rings[appID]
+	if !ok || ring.fp != fp {
+		ring = buildHashRing(ins, fp)
+		s.rings[appID] = ring
+	}
+	s.mutex.Unlock()
+
+	h := hashKey(key)
+	idx := sort.Search(len(ring.entries), func(i int) bool { return ring.entries[i].hash >= h })
+	if idx == len(ring.entries) {
+		idx = 0
+	}
+	return ring.entries[idx].in, nil, nil
+}
+
+func buildHashRing(ins []*Instance, fp uint64) *hashRing {
+	entries := make([]hashRingEntry, 0, len(ins)*_hashReplicas)
+	for _, candidate := range ins {
+		addr := instanceAddr(candidate)
+		for i := 0; i < _hashReplicas; i++ {
+			entries = append(entries, hashRingEntry{hash: hashKey(fmt.Sprintf("%s#%d", addr, i)), in: candidate})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].hash < entries[j].hash })
+	return &hashRing{fp: fp, entries: entries}
+}
+
+func hashKey(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
@@ -0,0 +1,52 @@
+package naming
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// leastConn picks the candidate with the fewest in-flight requests, as
+// tracked by the done callback it hands back from Pick.
+type leastConn struct {
+	mutex  sync.Mutex
+	active map[string]map[string]*int64 // appID -> addr -> active count
+}
+
+// LeastConn returns a Selector that picks the candidate with the fewest
+// requests currently in flight, using an in-client active-request counter
+// incremented until the returned done callback is called.
+func LeastConn() Selector {
+	return &leastConn{active: map[string]map[string]*int64{}}
+}
+
+func (s *leastConn) Pick(appID string, ins []*Instance, key string) (in *Instance, done func(), err error) {
+	s.mutex.Lock()
+	counts, ok := s.active[appID]
+	if !ok {
+		counts = map[string]*int64{}
+		s.active[appID] = counts
+	}
+	var (
+		best     *Instance
+		bestAddr string
+		bestN    int64 = -1
+	)
+	for _, candidate := range ins {
+		addr := instanceAddr(candidate)
+		c, ok := counts[addr]
+		if !ok {
+			c = new(int64)
+			counts[addr] = c
+		}
+		if n := atomic.LoadInt64(c); bestN == -1 || n < bestN {
+			best, bestAddr, bestN = candidate, addr, n
+		}
+	}
+	counter := counts[bestAddr]
+	atomic.AddInt64(counter, 1)
+	s.mutex.Unlock()
+
+	var once sync.Once
+	done = func() { once.Do(func() { atomic.AddInt64(counter, -1) }) }
+	return best, done, nil
+}
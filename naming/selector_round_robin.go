@@ -0,0 +1,23 @@
+package naming
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// roundRobin cycles through candidates in order, tracking a counter per
+// appID so unrelated watches don't perturb each other's rotation.
+type roundRobin struct {
+	counters sync.Map // appID -> *uint64
+}
+
+// RoundRobin returns a Selector that cycles through candidates in order.
+func RoundRobin() Selector {
+	return &roundRobin{}
+}
+
+func (s *roundRobin) Pick(appID string, ins []*Instance, key string) (in *Instance, done func(), err error) {
+	v, _ := s.counters.LoadOrStore(appID, new(uint64))
+	n := atomic.AddUint64(v.(*uint64), 1)
+	return ins[(n-1)%uint64(len(ins))], nil, nil
+}
@@ -0,0 +1,67 @@
+package naming_test
+
+import (
+	"testing"
+
+	"github.com/Bilibili/discovery/naming"
+)
+
+// TestRoundRobinFairness checks that RoundRobin cycles through candidates
+// evenly rather than favoring any one of them.
+func TestRoundRobinFairness(t *testing.T) {
+	ins := []*naming.Instance{
+		{Addrs: []string{"10.0.0.1:80"}},
+		{Addrs: []string{"10.0.0.2:80"}},
+		{Addrs: []string{"10.0.0.3:80"}},
+	}
+	s := naming.RoundRobin()
+	const rounds = 30
+	counts := map[string]int{}
+	for i := 0; i < rounds; i++ {
+		in, done, err := s.Pick("provider", ins, "")
+		if err != nil {
+			t.Fatalf("Pick() error = %v", err)
+		}
+		if done != nil {
+			done()
+		}
+		counts[in.Addrs[0]]++
+	}
+	want := rounds / len(ins)
+	for _, in := range ins {
+		if got := counts[in.Addrs[0]]; got != want {
+			t.Errorf("counts[%s] = %d, want %d", in.Addrs[0], got, want)
+		}
+	}
+}
+
+// TestConsistentHashAffinity checks that ConsistentHash routes the same
+// key to the same instance across repeated calls, as long as the
+// candidate set is stable.
+func TestConsistentHashAffinity(t *testing.T) {
+	ins := []*naming.Instance{
+		{Addrs: []string{"10.0.0.1:80"}},
+		{Addrs: []string{"10.0.0.2:80"}},
+		{Addrs: []string{"10.0.0.3:80"}},
+	}
+	s := naming.ConsistentHash()
+	first, done, err := s.Pick("provider", ins, "session-42")
+	if err != nil {
+		t.Fatalf("Pick() error = %v", err)
+	}
+	if done != nil {
+		done()
+	}
+	for i := 0; i < 10; i++ {
+		in, done, err := s.Pick("provider", ins, "session-42")
+		if err != nil {
+			t.Fatalf("Pick() error = %v", err)
+		}
+		if done != nil {
+			done()
+		}
+		if in.Addrs[0] != first.Addrs[0] {
+			t.Fatalf("Pick(%q) = %s, want the same instance(%s) as the first call", "session-42", in.Addrs[0], first.Addrs[0])
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package naming
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// weightedRandom picks a candidate at random, weighted by its
+// metadata["weight"] (defaulting to 1 when absent or unparseable). It
+// keeps its own *rand.Rand rather than sharing http_backend.go's package
+// global -- Pick is called from arbitrary consumer goroutines, and
+// *rand.Rand isn't safe for concurrent use.
+type weightedRandom struct {
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+// WeightedRandom returns a Selector that picks a candidate at random,
+// weighted by the existing metadata["weight"] convention.
+func WeightedRandom() Selector {
+	return &weightedRandom{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (s *weightedRandom) Pick(appID string, ins []*Instance, key string) (in *Instance, done func(), err error) {
+	weights := make([]int, len(ins))
+	total := 0
+	for i, candidate := range ins {
+		w := 1
+		if v, ok := candidate.Metadata["weight"]; ok {
+			if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+				w = parsed
+			}
+		}
+		weights[i] = w
+		total += w
+	}
+	s.mutex.Lock()
+	pick := s.rand.Intn(total)
+	s.mutex.Unlock()
+	for i, w := range weights {
+		if pick < w {
+			return ins[i], nil, nil
+		}
+		pick -= w
+	}
+	return ins[len(ins)-1], nil, nil
+}
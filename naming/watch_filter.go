@@ -0,0 +1,52 @@
+package naming
+
+// WatchFilter subscribes to a stable subset of appID's instances matching
+// pred, e.g. ColorFilter("red") or a MetadataEqualsFilter, without callers
+// re-implementing filtering after every Watch event themselves. Unlike
+// Watch, the returned chan only fires when the filtered subset itself
+// changes (compared by fingerprint over its addrs), so a watcher of one
+// metadata value on a busy app isn't woken on every poll of appID.
+//
+// The returned chan is closed when appID is Unwatch'd.
+func (d *Discovery) WatchFilter(appID string, pred func(*Instance) bool) <-chan struct{} {
+	upstream := d.Watch(appID)
+	out := make(chan struct{}, 1)
+	go func() {
+		var (
+			lastFp uint64
+			has    bool
+		)
+		for range upstream {
+			ins, ok := d.FetchFiltered(appID, pred)
+			if !ok {
+				continue
+			}
+			if fp := fingerprint(ins); !has || fp != lastFp {
+				has, lastFp = true, fp
+				select {
+				case out <- struct{}{}:
+				default:
+				}
+			}
+		}
+		close(out)
+	}()
+	return out
+}
+
+// FetchFiltered returns the subset of appID's instances, across every
+// zone, matching pred.
+func (d *Discovery) FetchFiltered(appID string, pred func(in *Instance) bool) (ins []*Instance, ok bool) {
+	zoneIns, ok := d.Fetch(appID)
+	if !ok {
+		return nil, false
+	}
+	for _, zi := range zoneIns {
+		for _, in := range zi {
+			if pred(in) {
+				ins = append(ins, in)
+			}
+		}
+	}
+	return ins, true
+}